@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/jeffasante/photo-mood/thumb-svc/queue"
+)
+
+// applyFit resizes img per spec.Fit: "fill" scales and center-crops to fill
+// the box exactly, "crop" center-crops without scaling, and "fit" (the
+// default) scales preserving aspect ratio — a zero Height just constrains
+// width, matching the original single-thumbnail behavior.
+func applyFit(img image.Image, spec queue.OutputSpec) *image.NRGBA {
+	switch spec.Fit {
+	case "fill":
+		return imaging.Fill(img, spec.Width, spec.Height, imaging.Center, imaging.Lanczos)
+	case "crop":
+		return imaging.CropCenter(img, spec.Width, spec.Height)
+	default:
+		if spec.Width > 0 && spec.Height > 0 {
+			// Scale by whichever side is the tighter constraint so the result
+			// fits inside the box without distorting the aspect ratio.
+			b := img.Bounds()
+			if b.Dx()*spec.Height > b.Dy()*spec.Width {
+				return imaging.Resize(img, spec.Width, 0, imaging.Lanczos)
+			}
+			return imaging.Resize(img, 0, spec.Height, imaging.Lanczos)
+		}
+		return imaging.Resize(img, spec.Width, spec.Height, imaging.Lanczos)
+	}
+}
+
+func normalizeFormat(format string) string {
+	switch format {
+	case "", "png":
+		return "png"
+	case "jpg", "jpeg":
+		return "jpeg"
+	case "webp":
+		return "webp"
+	case "avif":
+		return "avif"
+	default:
+		return format
+	}
+}
+
+// encodeOutput encodes img per spec into buf. PNG/JPEG go through the
+// stdlib-backed imaging encoder; WebP/AVIF are behind build tags (see
+// encode_webp.go, encode_avif.go) since they pull in cgo dependencies.
+func encodeOutput(buf *bytes.Buffer, img image.Image, spec queue.OutputSpec) error {
+	switch normalizeFormat(spec.Format) {
+	case "png":
+		return imaging.Encode(buf, img, imaging.PNG)
+	case "jpeg":
+		quality := spec.Quality
+		if quality <= 0 {
+			quality = 85
+		}
+		return imaging.Encode(buf, img, imaging.JPEG, imaging.JPEGQuality(quality))
+	case "webp":
+		return encodeWebP(buf, img, spec.Quality)
+	case "avif":
+		return encodeAVIF(buf, img, spec.Quality)
+	default:
+		return fmt.Errorf("unsupported output format %q", spec.Format)
+	}
+}
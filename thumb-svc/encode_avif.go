@@ -0,0 +1,20 @@
+//go:build avif
+
+package main
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/Kagami/go-avif"
+)
+
+// encodeAVIF is only built with -tags avif, since github.com/Kagami/go-avif
+// links libaom via cgo; operators who don't need AVIF output skip that
+// dependency entirely.
+func encodeAVIF(buf *bytes.Buffer, img image.Image, quality int) error {
+	if quality <= 0 {
+		quality = 80
+	}
+	return avif.Encode(buf, img, &avif.Options{Quality: quality})
+}
@@ -0,0 +1,13 @@
+//go:build !avif
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+func encodeAVIF(buf *bytes.Buffer, img image.Image, quality int) error {
+	return fmt.Errorf("avif output requested but this binary was built without -tags avif")
+}
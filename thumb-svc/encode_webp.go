@@ -0,0 +1,20 @@
+//go:build webp
+
+package main
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/chai2010/webp"
+)
+
+// encodeWebP is only built with -tags webp, since github.com/chai2010/webp
+// needs libwebp via cgo; operators who don't need WebP output skip that
+// dependency entirely.
+func encodeWebP(buf *bytes.Buffer, img image.Image, quality int) error {
+	if quality <= 0 {
+		quality = 80
+	}
+	return webp.Encode(buf, img, &webp.Options{Quality: float32(quality)})
+}
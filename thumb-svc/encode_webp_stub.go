@@ -0,0 +1,13 @@
+//go:build !webp
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+func encodeWebP(buf *bytes.Buffer, img image.Image, quality int) error {
+	return fmt.Errorf("webp output requested but this binary was built without -tags webp")
+}
@@ -0,0 +1,27 @@
+package main
+
+import "errors"
+
+// stageError tags a processing failure with whether retrying the job could
+// plausibly succeed. Invalid input (a corrupt/unsupported image) never will,
+// and a canceled job isn't retried either, so those are terminal; other
+// processing failures are tagged retryable. An error that isn't a
+// *stageError is treated as terminal by isRetryable.
+type stageError struct {
+	err       error
+	retryable bool
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+func retryableError(err error) error { return &stageError{err: err, retryable: true} }
+func terminalError(err error) error  { return &stageError{err: err, retryable: false} }
+
+func isRetryable(err error) bool {
+	var se *stageError
+	if errors.As(err, &se) {
+		return se.retryable
+	}
+	return false
+}
@@ -4,35 +4,47 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/jeffasante/photo-mood/thumb-svc/queue"
 )
 
 // Configuration
 var (
-	redisURL     = getEnv("REDIS_URL", "redis://localhost:6379")
-	queueName    = getEnv("QUEUE_NAME", "thumbnail-queue")
+	redisURL      = getEnv("REDIS_URL", "redis://localhost:6379")
+	queueType     = getEnv("QUEUE_TYPE", "redis-streams")
+	queueName     = getEnv("QUEUE_NAME", "thumbnail-queue")
+	streamName    = getEnv("STREAM_NAME", "thumbnail-stream")
+	groupName     = getEnv("GROUP_NAME", "thumb-workers")
+	diskQueueDir  = getEnv("DISK_QUEUE_DIR", "./data/queue")
 	resultChannel = "thumbnail-results"
-	workerID     = fmt.Sprintf("thumb-worker-%d", os.Getpid())
+	workerID      = fmt.Sprintf("thumb-worker-%d", os.Getpid())
+	claimMinIdle  = getEnvDuration("CLAIM_MIN_IDLE", 60*time.Second)
+	reclaimEvery  = getEnvDuration("RECLAIM_INTERVAL", 30*time.Second)
+
+	defaultMaxAttempts = getEnvInt("MAX_ATTEMPTS", 5)
+	retryBaseDelay     = getEnvDuration("RETRY_BASE_DELAY", 2*time.Second)
+	retryMaxDelay      = getEnvDuration("RETRY_MAX_DELAY", 5*time.Minute)
+	retryPollInterval  = getEnvDuration("RETRY_POLL_INTERVAL", 1*time.Second)
+
+	controlCheckInterval = getEnvDuration("CONTROL_CHECK_INTERVAL", 2*time.Second)
 )
 
-// Job represents a thumbnail job
-type Job struct {
-	RequestID string `json:"requestId"`
-	FileName  string `json:"fileName"`
-	ImageData string `json:"imageData"`
-	Timestamp int64  `json:"timestamp"`
-}
+const (
+	retryZSetKey  = "thumbnail-retries"
+	deadLetterKey = "thumbnail-deadletter"
+)
 
 // Result represents the job result
 type Result struct {
@@ -44,17 +56,26 @@ type Result struct {
 	ProcessedAt string      `json:"processedAt"`
 }
 
-// ThumbnailData represents the thumbnail response data
-type ThumbnailData struct {
-	Thumbnail     string                 `json:"thumbnail"`
-	OriginalSize  map[string]interface{} `json:"original_size"`
-	ThumbnailSize map[string]interface{} `json:"thumbnail_size"`
+// OutputResult is one named, resized/encoded variant produced for a job.
+type OutputResult struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Data   string `json:"data"`
+}
+
+// ProcessedImage is the Result.Data payload: the source image's dimensions
+// plus every output the job's presets (or defaults) asked for.
+type ProcessedImage struct {
+	OriginalSize map[string]interface{}  `json:"original_size"`
+	Outputs      map[string]OutputResult `json:"outputs"`
 }
 
 var (
-	rdb    *redis.Client
-	ctx    = context.Background()
-	router *gin.Engine
+	rdb     *redis.Client
+	ctx     = context.Background()
+	router  *gin.Engine
+	backend queue.Backend
 )
 
 func getEnv(key, defaultValue string) string {
@@ -64,87 +85,148 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer for %s, using default %d", key, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s, using default %s", key, defaultValue)
+	}
+	return defaultValue
+}
+
 func initRedis() error {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return fmt.Errorf("failed to parse Redis URL: %v", err)
 	}
 
-	rdb = redis.NewClient(opt)
+	client := redis.NewClient(opt)
 
 	// Test connection
-	_, err = rdb.Ping(ctx).Result()
-	if err != nil {
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		client.Close()
 		return fmt.Errorf("failed to connect to Redis: %v", err)
 	}
 
+	rdb = client
 	log.Printf("[%s] Connected to Redis: %s", workerID, redisURL)
 	return nil
 }
 
-func processImage(job Job) Result {
+// newBackend selects a queue.Backend implementation based on QUEUE_TYPE,
+// mirroring the env-driven backend switch Gitea uses for its indexer queue
+// (ISSUE_INDEXER_QUEUE_TYPE=levelqueue|redis).
+func newBackend() (queue.Backend, error) {
+	switch queueType {
+	case "redis":
+		return queue.NewRedisListBackend(rdb, queueName, 30*time.Second), nil
+	case "redis-streams":
+		return queue.NewRedisStreamsBackend(rdb, streamName, groupName, workerID, 30*time.Second)
+	case "disk":
+		return queue.NewDiskBackend(diskQueueDir)
+	case "memory":
+		return queue.NewMemoryBackend(256), nil
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_TYPE %q (want redis, redis-streams, disk, or memory)", queueType)
+	}
+}
+
+// processImage runs the decode/resize/encode pipeline for a job, publishing
+// a progress event before decoding and before resizing, and an "encoding"
+// event once every output has been resized and encoded, so a caller watching
+// thumbnail-results:<requestId> can show incremental status. ctx is checked
+// between stages so a disconnected requester (its control key expired,
+// see watchControlKey) aborts the job early instead of burning CPU on work
+// nobody's waiting for.
+//
+// The returned error, when non-nil, is always a *stageError so callers can
+// tell retryable failures (transient encoding issues) from terminal ones
+// (unsupported/corrupt images, or cancellation) via isRetryable.
+func processImage(ctx context.Context, job queue.Job) (Result, error) {
 	log.Printf("[%s] Processing image: %s (request: %s)", workerID, job.FileName, job.RequestID)
 
+	publishProgress(job.RequestID, "decoding", 0)
+	if err := ctx.Err(); err != nil {
+		procErr := terminalError(fmt.Errorf("processing canceled: %w", err))
+		return failureResult(job, procErr), procErr
+	}
+
 	// Decode base64 image
 	imageBytes, err := base64.StdEncoding.DecodeString(job.ImageData)
 	if err != nil {
-		return Result{
-			RequestID:   job.RequestID,
-			Success:     false,
-			Error:       fmt.Sprintf("Failed to decode image: %v", err),
-			Worker:      workerID,
-			ProcessedAt: time.Now().Format(time.RFC3339),
-		}
+		procErr := retryableError(fmt.Errorf("failed to decode base64: %w", err))
+		return failureResult(job, procErr), procErr
 	}
 
 	// Decode image
 	img, err := imaging.Decode(bytes.NewReader(imageBytes))
 	if err != nil {
-		return Result{
-			RequestID:   job.RequestID,
-			Success:     false,
-			Error:       fmt.Sprintf("Failed to decode image: %v", err),
-			Worker:      workerID,
-			ProcessedAt: time.Now().Format(time.RFC3339),
-		}
+		procErr := terminalError(fmt.Errorf("failed to decode image: %w", err))
+		return failureResult(job, procErr), procErr
 	}
 
 	originalWidth := img.Bounds().Dx()
 	originalHeight := img.Bounds().Dy()
 
-	// Resize to 200px width, preserving aspect ratio
-	thumbnail := imaging.Resize(img, 200, 0, imaging.Lanczos)
-	thumbnailWidth := thumbnail.Bounds().Dx()
-	thumbnailHeight := thumbnail.Bounds().Dy()
-
-	// Encode as PNG
-	buf := new(bytes.Buffer)
-	if err := imaging.Encode(buf, thumbnail, imaging.PNG); err != nil {
-		return Result{
-			RequestID:   job.RequestID,
-			Success:     false,
-			Error:       fmt.Sprintf("Failed to encode thumbnail: %v", err),
-			Worker:      workerID,
-			ProcessedAt: time.Now().Format(time.RFC3339),
+	specs := job.Outputs
+	if len(specs) == 0 {
+		specs = defaultPresets()
+	}
+
+	publishProgress(job.RequestID, "resizing", 0.4)
+	if err := ctx.Err(); err != nil {
+		procErr := terminalError(fmt.Errorf("processing canceled: %w", err))
+		return failureResult(job, procErr), procErr
+	}
+
+	outputs := make(map[string]OutputResult, len(specs))
+	totalBytes := 0
+
+	for _, spec := range specs {
+		if err := ctx.Err(); err != nil {
+			procErr := terminalError(fmt.Errorf("processing canceled: %w", err))
+			return failureResult(job, procErr), procErr
+		}
+
+		resized := applyFit(img, spec)
+
+		buf := new(bytes.Buffer)
+		if err := encodeOutput(buf, resized, spec); err != nil {
+			procErr := retryableError(fmt.Errorf("failed to encode output %q: %w", spec.Name, err))
+			return failureResult(job, procErr), procErr
+		}
+
+		outputs[spec.Name] = OutputResult{
+			Format: normalizeFormat(spec.Format),
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+			Data:   base64.StdEncoding.EncodeToString(buf.Bytes()),
 		}
+		totalBytes += buf.Len()
 	}
 
-	// Base64 encode
-	b64String := base64.StdEncoding.EncodeToString(buf.Bytes())
+	publishProgress(job.RequestID, "encoding", 0.8)
 
-	data := ThumbnailData{
-		Thumbnail: b64String,
+	data := ProcessedImage{
 		OriginalSize: map[string]interface{}{
 			"width":  originalWidth,
 			"height": originalHeight,
 		},
-		ThumbnailSize: map[string]interface{}{
-			"width":  thumbnailWidth,
-			"height": thumbnailHeight,
-		},
+		Outputs: outputs,
 	}
 
-	log.Printf("[%s] Successfully processed %s (size: %d bytes)", workerID, job.FileName, buf.Len())
+	log.Printf("[%s] Successfully processed %s into %d output(s) (%d bytes total)", workerID, job.FileName, len(outputs), totalBytes)
 
 	return Result{
 		RequestID:   job.RequestID,
@@ -152,49 +234,78 @@ func processImage(job Job) Result {
 		Data:        data,
 		Worker:      workerID,
 		ProcessedAt: time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+func failureResult(job queue.Job, err error) Result {
+	return Result{
+		RequestID:   job.RequestID,
+		Success:     false,
+		Error:       err.Error(),
+		Worker:      workerID,
+		ProcessedAt: time.Now().Format(time.RFC3339),
 	}
 }
 
-func queueWorker() {
-	log.Printf("[%s] Starting queue worker for %s", workerID, queueName)
-
-	for {
-		// Block and wait for jobs (30 second timeout)
-		queueResult := rdb.BRPop(ctx, 30*time.Second, queueName)
-		if queueResult.Err() != nil {
-			if queueResult.Err() == redis.Nil {
-				// Timeout, continue polling
-				continue
-			}
-			log.Printf("[%s] Queue error: %v", workerID, queueResult.Err())
-			time.Sleep(5 * time.Second)
-			continue
-		}
+// handleFailure decides whether a failed job gets another attempt or is
+// moved to the dead-letter queue, and only publishes the terminal result
+// once that decision is made (callers shouldn't see a "failed" result for
+// a job that's about to be retried). The retry schedule and dead-letter
+// queue both live in Redis; without it (QUEUE_TYPE=disk/memory running
+// with no Redis reachable) there's nowhere to persist either, so a failure
+// is simply terminal.
+func handleFailure(job queue.Job, procErr error, result Result) {
+	if rdb == nil {
+		publishResult(result)
+		return
+	}
 
-		jobData := queueResult.Val()[1] // [1] is the job data, [0] is the queue name
+	if isRetryable(procErr) && job.Attempts < job.MaxAttempts {
+		scheduleRetry(job, procErr)
+		return
+	}
 
-		var job Job
-		if err := json.Unmarshal([]byte(jobData), &job); err != nil {
-			log.Printf("[%s] Invalid job data: %v", workerID, err)
-			continue
-		}
+	deadLetter(job, procErr)
+	publishResult(result)
+}
 
-		log.Printf("[%s] Received job: %s", workerID, job.RequestID)
+// publishResult emits the terminal progress event ("done" or "failed") for
+// a job onto its per-request channel.
+func publishResult(result Result) {
+	stage := "done"
+	if !result.Success {
+		stage = "failed"
+	}
+
+	publishEvent(ProgressEvent{
+		RequestID: result.RequestID,
+		Stage:     stage,
+		Progress:  1,
+		Data:      result.Data,
+		Error:     result.Error,
+	})
+
+	log.Printf("[%s] Published %s event for %s", workerID, stage, result.RequestID)
+}
 
-		// Process the job
-		jobResult := processImage(job)
+// reclaimLoop periodically asks the backend to hand over entries that have
+// been pending for longer than claimMinIdle, so a worker that dies mid-job
+// doesn't strand it forever. Only backends that track ownership (currently
+// Redis Streams) implement queue.Reclaimer.
+func reclaimLoop() {
+	reclaimer := backend.(queue.Reclaimer)
 
-		// Publish result
-		resultJSON, err := json.Marshal(jobResult)
+	ticker := time.NewTicker(reclaimEvery)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := reclaimer.ReclaimIdle(ctx, claimMinIdle)
 		if err != nil {
-			log.Printf("[%s] Failed to marshal result: %v", workerID, err)
+			log.Printf("[%s] Reclaim error: %v", workerID, err)
 			continue
 		}
-
-		if err := rdb.Publish(ctx, resultChannel, resultJSON).Err(); err != nil {
-			log.Printf("[%s] Failed to publish result: %v", workerID, err)
-		} else {
-			log.Printf("[%s] Published result for %s", workerID, jobResult.RequestID)
+		if n > 0 {
+			log.Printf("[%s] Reclaimed %d idle entries from peers", workerID, n)
 		}
 	}
 }
@@ -207,26 +318,58 @@ func setupRoutes() {
 	router.GET("/", healthCheck)
 	router.GET("/health", healthCheck)
 
+	// Stream/group stats for operators (redis-streams backend only)
+	router.GET("/metrics", metricsHandler)
+
+	// Dead-letter admin endpoints
+	router.GET("/deadletter", deadLetterListHandler)
+	router.POST("/deadletter/:id/requeue", deadLetterRequeueHandler)
+
 	// Legacy endpoint for direct calls (fallback)
 	router.POST("/resize", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "This service now processes requests via message queue",
 			"worker":  workerID,
-			"queue":   queueName,
+			"queue":   queueType,
 		})
 	})
 }
 
-func healthCheck(c *gin.Context) {
-	// Check Redis connection
-	_, err := rdb.Ping(ctx).Result()
-	redisStatus := "connected"
+func metricsHandler(c *gin.Context) {
+	streams, ok := backend.(*queue.RedisStreamsBackend)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"queue": queueType, "message": "metrics only available for the redis-streams backend"})
+		return
+	}
+
+	pending, maxIdleMs, deliveries, err := streams.Metrics(ctx)
 	if err != nil {
-		redisStatus = "disconnected"
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stream":      streamName,
+		"group":       groupName,
+		"pending":     pending,
+		"max_idle_ms": maxIdleMs,
+		"deliveries":  deliveries,
+	})
+}
+
+func healthCheck(c *gin.Context) {
+	// Check Redis connection, if this deployment even uses one — disk/memory
+	// backends can run with rdb == nil (see initRedis's caller in main).
+	redisStatus := "not configured"
+	if rdb != nil {
+		redisStatus = "connected"
+		if _, err := rdb.Ping(ctx).Result(); err != nil {
+			redisStatus = "disconnected"
+		}
 	}
 
 	status := "healthy"
-	if redisStatus != "connected" {
+	if redisStatus == "disconnected" {
 		status = "unhealthy"
 	}
 
@@ -235,21 +378,43 @@ func healthCheck(c *gin.Context) {
 		"service": "thumb-svc",
 		"worker":  workerID,
 		"redis":   redisStatus,
-		"queue":   queueName,
+		"queue":   queueType,
 	})
 }
 
 func main() {
-	// Initialize Redis
+	// Redis is only a hard requirement for the redis/redis-streams backends.
+	// disk and memory exist precisely so a single-node or air-gapped deploy
+	// doesn't need Redis running at all; for those, a connection failure is
+	// logged and the retry/dead-letter subsystem, progress pub/sub, and the
+	// control-key watcher just stay disabled (see the rdb == nil checks in
+	// retry.go and progress.go's publishEvent/watchControlKey) instead of
+	// refusing to start.
+	requiresRedis := queueType == "redis" || queueType == "redis-streams"
 	if err := initRedis(); err != nil {
+		if requiresRedis {
+			log.Fatal(err)
+		}
+		log.Printf("[%s] Redis unavailable (%v); continuing without retry/dead-letter and progress events", workerID, err)
+	}
+
+	// Select the queue backend
+	b, err := newBackend()
+	if err != nil {
 		log.Fatal(err)
 	}
+	backend = b
 
 	// Setup HTTP routes
 	setupRoutes()
 
-	// Start queue worker in background
-	go queueWorker()
+	// Start the worker pool and retry scheduler in background
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	queueWorker(stop, &wg)
+	if rdb != nil {
+		go retryScheduler()
+	}
 
 	// Start HTTP server in background
 	server := &http.Server{
@@ -273,17 +438,27 @@ func main() {
 
 	log.Printf("[%s] Shutting down gracefully...", workerID)
 
+	// Stop pulling new jobs, then give in-flight ones up to shutdownTimeout
+	// to finish before aborting them.
+	close(stop)
+	drainWorkers(&wg)
+
 	// Shutdown HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
-	// Close Redis connection
-	if err := rdb.Close(); err != nil {
-		log.Printf("Error closing Redis: %v", err)
+	// Close the queue backend and Redis connection
+	if err := backend.Close(); err != nil {
+		log.Printf("Error closing queue backend: %v", err)
+	}
+	if rdb != nil {
+		if err := rdb.Close(); err != nil {
+			log.Printf("Error closing Redis: %v", err)
+		}
 	}
 
 	log.Printf("[%s] Shutdown complete", workerID)
-}
\ No newline at end of file
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/jeffasante/photo-mood/thumb-svc/queue"
+)
+
+// tinyPNG returns a base64-encoded 10x10 PNG so processImage has something
+// real to decode and resize.
+func tinyPNG(t *testing.T) string {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 50, B: 50, A: 255})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("failed to encode test PNG: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestProcessImageViaMemoryBackend(t *testing.T) {
+	workerID = "test-worker"
+	backend = queue.NewMemoryBackend(1)
+
+	job := queue.Job{
+		RequestID: "req-1",
+		FileName:  "swatch.png",
+		ImageData: tinyPNG(t),
+		Timestamp: time.Now().UnixNano(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := backend.Enqueue(ctx, job); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	dequeued, ack, err := backend.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue failed: %v", err)
+	}
+
+	result, err := processImage(ctx, dequeued)
+	ack(nil)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	if !result.Success {
+		t.Fatalf("expected success, got error: %s", result.Error)
+	}
+
+	data, ok := result.Data.(ProcessedImage)
+	if !ok {
+		t.Fatalf("expected ProcessedImage, got %T", result.Data)
+	}
+	thumb, ok := data.Outputs["thumb"]
+	if !ok {
+		t.Fatalf("expected a %q output, got %v", "thumb", data.Outputs)
+	}
+	if thumb.Data == "" {
+		t.Fatal("expected non-empty thumbnail data")
+	}
+}
+
+func TestProcessImageInvalidBase64IsRetryable(t *testing.T) {
+	workerID = "test-worker"
+
+	result, err := processImage(context.Background(), queue.Job{
+		RequestID: "req-2",
+		FileName:  "bad.png",
+		ImageData: "not-base64!!",
+	})
+
+	if result.Success {
+		t.Fatal("expected failure for invalid base64 payload")
+	}
+	if !isRetryable(err) {
+		t.Fatal("expected a bad base64 payload to be classified as retryable")
+	}
+}
+
+func TestProcessImageUnsupportedFormatIsTerminal(t *testing.T) {
+	workerID = "test-worker"
+
+	_, err := processImage(context.Background(), queue.Job{
+		RequestID: "req-3",
+		FileName:  "not-an-image.png",
+		ImageData: base64.StdEncoding.EncodeToString([]byte("not an image")),
+	})
+
+	if err == nil {
+		t.Fatal("expected an error for an undecodable image")
+	}
+	if isRetryable(err) {
+		t.Fatal("expected an unsupported/corrupt image to be classified as terminal")
+	}
+}
+
+func TestProcessImageCanceledContext(t *testing.T) {
+	workerID = "test-worker"
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := processImage(canceledCtx, queue.Job{
+		RequestID: "req-4",
+		FileName:  "swatch.png",
+		ImageData: tinyPNG(t),
+	})
+
+	if result.Success {
+		t.Fatal("expected failure for an already-canceled context")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error to wrap context.Canceled, got %v", err)
+	}
+}
+
+// TestWatchControlKeyWithoutRedisDoesNotPanic exercises the scenario
+// processJob hits on every job when QUEUE_TYPE=disk/memory runs without
+// Redis reachable: watchControlKey's ticker goroutine must not dereference
+// the nil rdb once it's had a chance to tick a few times past
+// controlCheckInterval, and the returned context must never self-cancel
+// since there's no control key to watch.
+func TestWatchControlKeyWithoutRedisDoesNotPanic(t *testing.T) {
+	savedRDB := rdb
+	savedInterval := controlCheckInterval
+	rdb = nil
+	controlCheckInterval = 5 * time.Millisecond
+	defer func() {
+		rdb = savedRDB
+		controlCheckInterval = savedInterval
+	}()
+
+	watchCtx, stop := watchControlKey(context.Background(), "req-no-redis")
+	defer stop()
+
+	time.Sleep(10 * controlCheckInterval)
+
+	if err := watchCtx.Err(); err != nil {
+		t.Fatalf("expected watchControlKey to never cancel without Redis, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/jeffasante/photo-mood/thumb-svc/queue"
+	"gopkg.in/yaml.v3"
+)
+
+var presetsFile = getEnv("PRESETS_FILE", "presets.yaml")
+
+// defaultPresetList is used whenever presetsFile doesn't exist and a job
+// doesn't specify its own Outputs.
+var defaultPresetList = []queue.OutputSpec{
+	{Name: "thumb", Width: 200, Fit: "fit", Format: "png"},
+	{Name: "medium", Width: 800, Fit: "fit", Format: "jpeg", Quality: 85},
+	{Name: "large", Width: 1600, Fit: "fit", Format: "jpeg", Quality: 90},
+}
+
+// activePresets is resolved once at startup so ops can override the default
+// sizes by dropping a presets.yaml in the working directory (or pointing
+// PRESETS_FILE at one) without a redeploy.
+var activePresets = loadPresets()
+
+type presetsDocument struct {
+	Presets []queue.OutputSpec `yaml:"presets"`
+}
+
+func loadPresets() []queue.OutputSpec {
+	data, err := os.ReadFile(presetsFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read presets file %s: %v, using defaults", presetsFile, err)
+		}
+		return defaultPresetList
+	}
+
+	var doc presetsDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		log.Printf("Failed to parse presets file %s: %v, using defaults", presetsFile, err)
+		return defaultPresetList
+	}
+
+	if len(doc.Presets) == 0 {
+		return defaultPresetList
+	}
+
+	log.Printf("Loaded %d preset(s) from %s", len(doc.Presets), presetsFile)
+	return doc.Presets
+}
+
+func defaultPresets() []queue.OutputSpec {
+	return activePresets
+}
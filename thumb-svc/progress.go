@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ProgressEvent is published to thumbnail-results:<requestId> at each stage
+// of processing a job, ending with a terminal "done" or "failed" event that
+// carries the same data/error a Result would.
+type ProgressEvent struct {
+	RequestID string      `json:"requestId"`
+	Stage     string      `json:"stage"`
+	Progress  float64     `json:"progress,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+func resultChannelFor(requestID string) string {
+	return fmt.Sprintf("%s:%s", resultChannel, requestID)
+}
+
+// publishProgress emits an intermediate (non-terminal) stage update.
+func publishProgress(requestID, stage string, pct float64) {
+	publishEvent(ProgressEvent{RequestID: requestID, Stage: stage, Progress: pct})
+}
+
+func publishEvent(event ProgressEvent) {
+	if rdb == nil {
+		// No Redis configured (e.g. exercising processImage in a unit test
+		// against the memory backend) — nothing to publish to.
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[%s] Failed to marshal %s event for %s: %v", workerID, event.Stage, event.RequestID, err)
+		return
+	}
+
+	if err := rdb.Publish(ctx, resultChannelFor(event.RequestID), payload).Err(); err != nil {
+		log.Printf("[%s] Failed to publish %s event for %s: %v", workerID, event.Stage, event.RequestID, err)
+	}
+}
+
+func controlKeyFor(requestID string) string {
+	return fmt.Sprintf("thumbnail-control:%s", requestID)
+}
+
+// watchControlKey returns a context derived from parent that's canceled once
+// a poll (every controlCheckInterval) finds that the job's control key,
+// having existed, has disappeared. Callers (e.g. an SSE handler
+// streaming progress to the browser) are expected to keep the key alive
+// with a refreshed TTL for as long as they're still listening; once they
+// disconnect, the key expires and the worker can stop burning CPU on work
+// nobody wants anymore. The returned stop func must be called once
+// processing finishes to release the watcher goroutine.
+func watchControlKey(parent context.Context, requestID string) (context.Context, func()) {
+	watchCtx, cancel := context.WithCancel(parent)
+
+	if rdb == nil {
+		// No Redis configured (e.g. QUEUE_TYPE=disk/memory without it
+		// reachable) — there's no control key to watch, so never cancel
+		// early; processing runs to completion or the caller's own context.
+		return watchCtx, cancel
+	}
+
+	go func() {
+		ticker := time.NewTicker(controlCheckInterval)
+		defer ticker.Stop()
+
+		key := controlKeyFor(requestID)
+		seenKey := false // only cancel once the key has existed and then vanished
+
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-ticker.C:
+				exists, err := rdb.Exists(context.Background(), key).Result()
+				if err != nil {
+					continue
+				}
+				if exists > 0 {
+					seenKey = true
+					continue
+				}
+				if seenKey {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return watchCtx, cancel
+}
@@ -0,0 +1,74 @@
+// Package queue abstracts the durability and delivery semantics of the
+// thumbnail job queue behind a single Backend interface, so the worker loop
+// can run against Redis, an embedded disk log, or an in-memory fake without
+// changing its processing code.
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoJob is returned by Dequeue when no job became available before the
+// backend's internal poll/block window elapsed. Callers should treat this as
+// a normal empty-queue tick, not a fatal error.
+var ErrNoJob = errors.New("queue: no job available")
+
+// Job represents a unit of work enqueued for a thumbnail worker.
+type Job struct {
+	RequestID string `json:"requestId"`
+	FileName  string `json:"fileName"`
+	ImageData string `json:"imageData"`
+	Timestamp int64  `json:"timestamp"`
+
+	// Attempts is how many times this job has been dequeued and processed,
+	// including the current attempt. MaxAttempts bounds retries before a
+	// failing job is moved to the dead-letter queue; 0 means "use the
+	// worker's default".
+	Attempts    int `json:"attempts"`
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// Outputs lists the named resized/encoded variants to produce from a
+	// single decode. If empty, the worker falls back to its configured
+	// default presets.
+	Outputs []OutputSpec `json:"outputs,omitempty"`
+}
+
+// OutputSpec describes one resized/encoded variant a job should produce.
+type OutputSpec struct {
+	Name    string `json:"name" yaml:"name"`
+	Width   int    `json:"width" yaml:"width"`
+	Height  int    `json:"height" yaml:"height"`
+	Fit     string `json:"fit,omitempty" yaml:"fit,omitempty"`       // fit, fill, or crop
+	Format  string `json:"format,omitempty" yaml:"format,omitempty"` // png, jpeg, webp, or avif
+	Quality int    `json:"quality,omitempty" yaml:"quality,omitempty"`
+}
+
+// Backend is implemented by every queue transport the worker can run
+// against (Redis list, Redis Streams, disk, in-memory).
+type Backend interface {
+	// Enqueue adds a job to the backend.
+	Enqueue(ctx context.Context, job Job) error
+
+	// Dequeue blocks until a job is available or ctx is done. The returned
+	// ack func must be called exactly once when processing finishes: ack(nil)
+	// marks the job done, ack(err) lets the backend decide how to handle a
+	// failed attempt (e.g. leave it pending for reclaim, or requeue it).
+	// Dequeue returns ErrNoJob if its internal wait timed out with nothing
+	// available, so the worker loop can just retry.
+	Dequeue(ctx context.Context) (Job, func(error), error)
+
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// Reclaimer is implemented by backends that can hand jobs stuck on a dead
+// consumer to another one. Backends that don't track ownership (memory,
+// disk) simply don't implement it.
+type Reclaimer interface {
+	// ReclaimIdle claims entries that have been pending for longer than
+	// minIdle and makes them available via Dequeue again. It returns how
+	// many entries were reclaimed.
+	ReclaimIdle(ctx context.Context, minIdle time.Duration) (int, error)
+}
@@ -0,0 +1,255 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskBackend is a single-node, file-backed Backend for deployments that
+// don't run Redis (e.g. air-gapped installs). Jobs are appended to a
+// newline-delimited log, each assigned a 1-indexed line number, and a
+// checkpoint file records the highest line below which every entry has been
+// acked, so an unclean restart replays whatever wasn't committed yet instead
+// of losing it.
+//
+// Acks don't necessarily land in log order once a worker pool (see
+// workerpool.go) has several jobs in flight at once, so the checkpoint can't
+// just be a count bumped on every ack — that would let a later line's ack
+// skip over an earlier line that's still in flight or was requeued, losing
+// it permanently on the next replay. Instead the checkpoint file holds the
+// highest contiguously-acked line (nextCommit-1) plus every line acked past
+// it out of order, so replay can skip those individually instead of
+// replaying (and double-processing) them while it waits for the gap below
+// them to close.
+type DiskBackend struct {
+	mu             sync.Mutex
+	file           *os.File
+	checkpointPath string
+	nextLine       int64
+	nextCommit     int64
+	acked          map[int64]struct{}
+
+	queue chan logEntry
+}
+
+// logEntry pairs a job with the log line it was read from, so its ack can
+// advance the checkpoint precisely instead of just counting acks.
+type logEntry struct {
+	job  Job
+	line int64
+}
+
+// NewDiskBackend opens (or creates) the log and checkpoint files under dir
+// and replays any jobs that were logged but never acked.
+func NewDiskBackend(dir string) (*DiskBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("disk queue: %v", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, "jobs.log"), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("disk queue: %v", err)
+	}
+
+	b := &DiskBackend{
+		file:           file,
+		checkpointPath: filepath.Join(dir, "checkpoint"),
+		acked:          make(map[int64]struct{}),
+		queue:          make(chan logEntry, 1024),
+	}
+
+	if err := b.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("disk queue: %v", err)
+	}
+
+	return b, nil
+}
+
+// readCheckpoint parses the checkpoint file: a contiguous watermark followed
+// by any comma-separated lines acked out of order past it, e.g. "4,6,7" means
+// lines 1-4 and 6-7 are done but line 5 is still outstanding.
+func (b *DiskBackend) readCheckpoint() (watermark int64, acked map[int64]struct{}) {
+	acked = make(map[int64]struct{})
+
+	data, err := os.ReadFile(b.checkpointPath)
+	if err != nil {
+		return 0, acked
+	}
+
+	fields := strings.Split(strings.TrimSpace(string(data)), ",")
+	watermark, _ = strconv.ParseInt(fields[0], 10, 64)
+	for _, f := range fields[1:] {
+		if n, err := strconv.ParseInt(f, 10, 64); err == nil {
+			acked[n] = struct{}{}
+		}
+	}
+	return watermark, acked
+}
+
+// persistCheckpoint writes the current watermark and out-of-order acked
+// lines to disk. Callers must hold b.mu.
+func (b *DiskBackend) persistCheckpoint() {
+	extra := make([]int64, 0, len(b.acked))
+	for line := range b.acked {
+		extra = append(extra, line)
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+
+	var sb strings.Builder
+	sb.WriteString(strconv.FormatInt(b.nextCommit-1, 10))
+	for _, line := range extra {
+		sb.WriteByte(',')
+		sb.WriteString(strconv.FormatInt(line, 10))
+	}
+
+	_ = os.WriteFile(b.checkpointPath, []byte(sb.String()), 0o644)
+}
+
+// replay loads every log line that isn't yet fully accounted for by the
+// checkpoint back onto the in-memory queue, so unacked jobs survive a
+// restart without replaying ones already acked out of order.
+func (b *DiskBackend) replay() error {
+	watermark, acked := b.readCheckpoint()
+	b.acked = acked
+
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(b.file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+
+	var line int64
+	for scanner.Scan() {
+		line++
+		if line <= watermark {
+			continue
+		}
+		if _, done := acked[line]; done {
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			return fmt.Errorf("corrupt log entry %d: %v", line, err)
+		}
+		b.queue <- logEntry{job: job, line: line}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	b.nextCommit = watermark + 1
+	b.nextLine = line + 1
+	_, err := b.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// appendLine writes job to the log under a freshly assigned line number and
+// returns it.
+func (b *DiskBackend) appendLine(job Job) (int64, error) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	line := b.nextLine
+	if _, err := b.file.Write(append(payload, '\n')); err != nil {
+		return 0, err
+	}
+	if err := b.file.Sync(); err != nil {
+		return 0, err
+	}
+	b.nextLine++
+	return line, nil
+}
+
+func (b *DiskBackend) Enqueue(ctx context.Context, job Job) error {
+	line, err := b.appendLine(job)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case b.queue <- logEntry{job: job, line: line}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// commit marks line as acked and advances nextCommit (and the on-disk
+// checkpoint) past whatever contiguous run of acked lines that completes,
+// without assuming acks arrive in log order.
+func (b *DiskBackend) commit(line int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.acked[line] = struct{}{}
+	for {
+		if _, ok := b.acked[b.nextCommit]; !ok {
+			break
+		}
+		delete(b.acked, b.nextCommit)
+		b.nextCommit++
+	}
+
+	b.persistCheckpoint()
+}
+
+func (b *DiskBackend) Dequeue(ctx context.Context) (Job, func(error), error) {
+	select {
+	case entry := <-b.queue:
+		ack := func(procErr error) {
+			if procErr != nil {
+				// Redeliver durably by appending a fresh entry rather than
+				// pushing the original job back onto b.queue: that used to
+				// be a non-blocking send that silently dropped the job
+				// whenever the channel was full. The original line is now
+				// superseded, so it's safe to commit past it.
+				if _, err := b.appendAndQueue(entry.job); err != nil {
+					log.Printf("disk queue: failed to requeue line %d: %v", entry.line, err)
+				}
+				b.commit(entry.line)
+				return
+			}
+
+			b.commit(entry.line)
+		}
+		return entry.job, ack, nil
+	case <-ctx.Done():
+		return Job{}, nil, ctx.Err()
+	case <-time.After(30 * time.Second):
+		return Job{}, nil, ErrNoJob
+	}
+}
+
+// appendAndQueue is Enqueue without a caller-supplied ctx, for internal
+// requeues where there's nothing to cancel against.
+func (b *DiskBackend) appendAndQueue(job Job) (int64, error) {
+	line, err := b.appendLine(job)
+	if err != nil {
+		return 0, err
+	}
+	b.queue <- logEntry{job: job, line: line}
+	return line, nil
+}
+
+func (b *DiskBackend) Close() error {
+	return b.file.Close()
+}
@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiskBackendOutOfOrderAckSurvivesReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := NewDiskBackend(dir)
+	if err != nil {
+		t.Fatalf("NewDiskBackend failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, id := range []string{"job-1", "job-2", "job-3"} {
+		if err := b.Enqueue(ctx, Job{RequestID: id}); err != nil {
+			t.Fatalf("Enqueue(%s) failed: %v", id, err)
+		}
+	}
+
+	var acks []func(error)
+	var got []string
+	for i := 0; i < 3; i++ {
+		job, ack, err := b.Dequeue(ctx)
+		if err != nil {
+			t.Fatalf("Dequeue failed: %v", err)
+		}
+		got = append(got, job.RequestID)
+		acks = append(acks, ack)
+	}
+	if got[0] != "job-1" || got[1] != "job-2" || got[2] != "job-3" {
+		t.Fatalf("expected jobs in log order, got %v", got)
+	}
+
+	// Ack job-3 and job-2 before job-1, simulating a worker pool finishing
+	// later-dequeued jobs first. The checkpoint must not jump past job-1,
+	// which is still unacked.
+	acks[2](nil)
+	acks[1](nil)
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Restart: job-1 was never acked, so it must be replayed. job-2 and
+	// job-3 were acked and must not reappear.
+	b2, err := NewDiskBackend(dir)
+	if err != nil {
+		t.Fatalf("NewDiskBackend (restart) failed: %v", err)
+	}
+	defer b2.Close()
+
+	replayed := map[string]bool{}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		job, ack, err := b2.Dequeue(ctx)
+		cancel()
+		if err != nil {
+			break
+		}
+		replayed[job.RequestID] = true
+		ack(nil)
+	}
+
+	if !replayed["job-1"] {
+		t.Fatal("expected job-1 to be replayed after an out-of-order ack of later jobs")
+	}
+	if replayed["job-2"] || replayed["job-3"] {
+		t.Fatalf("expected already-acked jobs not to be replayed, got %v", replayed)
+	}
+}
+
+func TestDiskBackendFailedAckRedeliversInsteadOfDropping(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := NewDiskBackend(dir)
+	if err != nil {
+		t.Fatalf("NewDiskBackend failed: %v", err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := b.Enqueue(ctx, Job{RequestID: "retry-me"}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	job, ack, err := b.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue failed: %v", err)
+	}
+	ack(errors.New("processing failed"))
+
+	redelivered, _, err := b.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("expected the failed job to be redelivered, got error: %v", err)
+	}
+	if redelivered.RequestID != job.RequestID {
+		t.Fatalf("expected redelivered job %q, got %q", job.RequestID, redelivered.RequestID)
+	}
+}
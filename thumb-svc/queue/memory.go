@@ -0,0 +1,38 @@
+package queue
+
+import "context"
+
+// MemoryBackend is an in-process Backend fake with no external dependencies,
+// used in tests so processImage-style code paths can be exercised without a
+// running Redis.
+type MemoryBackend struct {
+	jobs chan Job
+}
+
+// NewMemoryBackend returns a MemoryBackend with room for capacity buffered
+// jobs before Enqueue blocks.
+func NewMemoryBackend(capacity int) *MemoryBackend {
+	return &MemoryBackend{jobs: make(chan Job, capacity)}
+}
+
+func (b *MemoryBackend) Enqueue(ctx context.Context, job Job) error {
+	select {
+	case b.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *MemoryBackend) Dequeue(ctx context.Context) (Job, func(error), error) {
+	select {
+	case job := <-b.jobs:
+		return job, func(error) {}, nil
+	case <-ctx.Done():
+		return Job{}, nil, ctx.Err()
+	}
+}
+
+func (b *MemoryBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisListBackend is the original Backend: a plain Redis list driven by
+// LPUSH/BRPOP. It is fire-and-forget — once Dequeue returns a job it is
+// already gone from Redis, so a crash between Dequeue and a successful ack
+// loses it. Kept for operators who don't need at-least-once delivery and
+// want the simplest possible transport; prefer RedisStreamsBackend otherwise.
+type RedisListBackend struct {
+	rdb       *redis.Client
+	queueName string
+	blockFor  time.Duration
+}
+
+// NewRedisListBackend returns a Backend backed by a Redis list named
+// queueName. blockFor is how long BRPOP waits per poll before Dequeue
+// returns ErrNoJob.
+func NewRedisListBackend(rdb *redis.Client, queueName string, blockFor time.Duration) *RedisListBackend {
+	return &RedisListBackend{rdb: rdb, queueName: queueName, blockFor: blockFor}
+}
+
+func (b *RedisListBackend) Enqueue(ctx context.Context, job Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return b.rdb.LPush(ctx, b.queueName, payload).Err()
+}
+
+func (b *RedisListBackend) Dequeue(ctx context.Context) (Job, func(error), error) {
+	result, err := b.rdb.BRPop(ctx, b.blockFor, b.queueName).Result()
+	if err == redis.Nil {
+		return Job{}, nil, ErrNoJob
+	}
+	if err != nil {
+		return Job{}, nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(result[1]), &job); err != nil {
+		return Job{}, nil, err
+	}
+
+	// Already popped off the list, so a clean ack has nothing left to do. A
+	// failed ack pushes the raw payload back onto the end BRPOP pops from,
+	// so the job is the next one picked up instead of being lost.
+	return job, func(procErr error) {
+		if procErr != nil {
+			b.rdb.RPush(context.Background(), b.queueName, result[1])
+		}
+	}, nil
+}
+
+func (b *RedisListBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStreamsBackend implements Backend on a Redis Stream with a consumer
+// group, giving at-least-once delivery: a job is only removed from the
+// group's pending entries list (PEL) once ack(nil) runs XACK. Jobs stuck on
+// a dead consumer can be recovered with ReclaimIdle.
+type RedisStreamsBackend struct {
+	rdb      *redis.Client
+	stream   string
+	group    string
+	consumer string
+	blockFor time.Duration
+
+	// reclaimed holds entries ReclaimIdle has already XCLAIMed for this
+	// consumer; Dequeue drains it before blocking on a fresh XREADGROUP.
+	reclaimed chan redis.XMessage
+}
+
+// NewRedisStreamsBackend creates the consumer group (ignoring BUSYGROUP if
+// it already exists) and returns a Backend bound to it. consumer should be
+// unique per worker process so XPENDING/XCLAIM can tell them apart.
+func NewRedisStreamsBackend(rdb *redis.Client, stream, group, consumer string, blockFor time.Duration) (*RedisStreamsBackend, error) {
+	err := rdb.XGroupCreateMkStream(context.Background(), stream, group, "$").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to create consumer group: %v", err)
+	}
+
+	return &RedisStreamsBackend{
+		rdb:       rdb,
+		stream:    stream,
+		group:     group,
+		consumer:  consumer,
+		blockFor:  blockFor,
+		reclaimed: make(chan redis.XMessage, 64),
+	}, nil
+}
+
+func (b *RedisStreamsBackend) Enqueue(ctx context.Context, job Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.stream,
+		Values: map[string]interface{}{"job": string(payload)},
+	}).Err()
+}
+
+func (b *RedisStreamsBackend) Dequeue(ctx context.Context) (Job, func(error), error) {
+	select {
+	case message := <-b.reclaimed:
+		return b.jobFromMessage(message)
+	default:
+	}
+
+	streams, err := b.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    b.group,
+		Consumer: b.consumer,
+		Streams:  []string{b.stream, ">"},
+		Count:    1,
+		Block:    b.blockFor,
+	}).Result()
+	if err == redis.Nil || (err == nil && (len(streams) == 0 || len(streams[0].Messages) == 0)) {
+		return Job{}, nil, ErrNoJob
+	}
+	if err != nil {
+		return Job{}, nil, err
+	}
+
+	return b.jobFromMessage(streams[0].Messages[0])
+}
+
+func (b *RedisStreamsBackend) jobFromMessage(message redis.XMessage) (Job, func(error), error) {
+	payload, ok := message.Values["job"].(string)
+	if !ok {
+		// Malformed entry: ack it immediately so it doesn't wedge the PEL.
+		b.rdb.XAck(context.Background(), b.stream, b.group, message.ID)
+		return Job{}, nil, fmt.Errorf("stream entry %s missing job field", message.ID)
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(payload), &job); err != nil {
+		b.rdb.XAck(context.Background(), b.stream, b.group, message.ID)
+		return Job{}, nil, fmt.Errorf("invalid job data in %s: %v", message.ID, err)
+	}
+
+	ack := func(procErr error) {
+		if procErr != nil {
+			// Leave it pending: ReclaimIdle (or another consumer) will
+			// pick it back up once it's been idle long enough.
+			return
+		}
+		b.rdb.XAck(context.Background(), b.stream, b.group, message.ID)
+	}
+
+	return job, ack, nil
+}
+
+func (b *RedisStreamsBackend) ReclaimIdle(ctx context.Context, minIdle time.Duration) (int, error) {
+	pending, err := b.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: b.stream,
+		Group:  b.group,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+		Idle:   minIdle,
+	}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		ids = append(ids, p.ID)
+	}
+
+	claimed, err := b.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   b.stream,
+		Group:    b.group,
+		Consumer: b.consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, message := range claimed {
+		b.reclaimed <- message
+	}
+
+	return len(claimed), nil
+}
+
+// Metrics reports pending-entry stats for the consumer group, used by the
+// /metrics endpoint.
+func (b *RedisStreamsBackend) Metrics(ctx context.Context) (pending, maxIdleMs, deliveries int64, err error) {
+	summary, err := b.rdb.XPending(ctx, b.stream, b.group).Result()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	entries, err := b.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: b.stream,
+		Group:  b.group,
+		Start:  "-",
+		End:    "+",
+		Count:  1000,
+	}).Result()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	for _, entry := range entries {
+		if idleMs := entry.Idle.Milliseconds(); idleMs > maxIdleMs {
+			maxIdleMs = idleMs
+		}
+		deliveries += entry.RetryCount
+	}
+
+	return summary.Count, maxIdleMs, deliveries, nil
+}
+
+func (b *RedisStreamsBackend) Close() error {
+	return nil
+}
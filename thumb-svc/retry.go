@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/jeffasante/photo-mood/thumb-svc/queue"
+)
+
+// DeadLetterEntry is what gets stored for a job that ran out of retries (or
+// hit a non-retryable error), so an operator can inspect and requeue it.
+type DeadLetterEntry struct {
+	ID       string    `json:"id"`
+	Job      queue.Job `json:"job"`
+	Error    string    `json:"error"`
+	Worker   string    `json:"worker"`
+	FailedAt string    `json:"failedAt"`
+}
+
+// scheduleRetry re-enqueues job after an exponential backoff delay, via a
+// Redis sorted set keyed by ready-at timestamp. retryScheduler promotes
+// entries back onto the main queue once they're due.
+func scheduleRetry(job queue.Job, procErr error) {
+	delay := retryDelay(job.Attempts)
+	readyAt := time.Now().Add(delay).UnixMilli()
+
+	payload, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("[%s] Failed to marshal job %s for retry: %v", workerID, job.RequestID, err)
+		deadLetter(job, procErr)
+		return
+	}
+
+	if err := rdb.ZAdd(ctx, retryZSetKey, &redis.Z{Score: float64(readyAt), Member: payload}).Err(); err != nil {
+		log.Printf("[%s] Failed to schedule retry for %s: %v", workerID, job.RequestID, err)
+		deadLetter(job, procErr)
+		return
+	}
+
+	log.Printf("[%s] Scheduled retry %d/%d for %s in %s", workerID, job.Attempts, job.MaxAttempts, job.RequestID, delay)
+}
+
+// retryDelay implements base * 2^(attempts-1), capped at retryMaxDelay.
+func retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := retryBaseDelay * time.Duration(1<<uint(attempts-1))
+	if delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// retryScheduler is the small goroutine that promotes ready retry entries
+// back onto the main queue.
+func retryScheduler() {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		promoteReadyRetries()
+	}
+}
+
+func promoteReadyRetries() {
+	now := fmt.Sprintf("%d", time.Now().UnixMilli())
+
+	entries, err := rdb.ZRangeByScore(ctx, retryZSetKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: now,
+	}).Result()
+	if err != nil {
+		log.Printf("Retry scheduler error: %v", err)
+		return
+	}
+
+	for _, payload := range entries {
+		var job queue.Job
+		if err := json.Unmarshal([]byte(payload), &job); err != nil {
+			log.Printf("Dropping malformed retry entry: %v", err)
+			rdb.ZRem(ctx, retryZSetKey, payload)
+			continue
+		}
+
+		if err := backend.Enqueue(ctx, job); err != nil {
+			log.Printf("Failed to re-enqueue retry for %s: %v", job.RequestID, err)
+			continue
+		}
+
+		rdb.ZRem(ctx, retryZSetKey, payload)
+	}
+}
+
+// deadLetter records a job that can't be retried any further alongside the
+// error that killed it.
+func deadLetter(job queue.Job, procErr error) {
+	entry := DeadLetterEntry{
+		ID:       fmt.Sprintf("%s-%d", job.RequestID, time.Now().UnixNano()),
+		Job:      job,
+		Error:    procErr.Error(),
+		Worker:   workerID,
+		FailedAt: time.Now().Format(time.RFC3339),
+	}
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[%s] Failed to marshal deadletter entry for %s: %v", workerID, job.RequestID, err)
+		return
+	}
+
+	if err := rdb.HSet(ctx, deadLetterKey, entry.ID, payload).Err(); err != nil {
+		log.Printf("[%s] Failed to push %s to deadletter: %v", workerID, job.RequestID, err)
+		return
+	}
+
+	log.Printf("[%s] Moved %s to deadletter after %d attempt(s): %v", workerID, job.RequestID, job.Attempts, procErr)
+}
+
+func deadLetterListHandler(c *gin.Context) {
+	if rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "dead-letter queue requires Redis, which isn't configured"})
+		return
+	}
+
+	raw, err := rdb.HGetAll(ctx, deadLetterKey).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries := make([]DeadLetterEntry, 0, len(raw))
+	for _, payload := range raw {
+		var entry DeadLetterEntry
+		if err := json.Unmarshal([]byte(payload), &entry); err != nil {
+			log.Printf("Skipping malformed deadletter entry: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deadletter": entries})
+}
+
+func deadLetterRequeueHandler(c *gin.Context) {
+	if rdb == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "dead-letter queue requires Redis, which isn't configured"})
+		return
+	}
+
+	id := c.Param("id")
+
+	payload, err := rdb.HGet(ctx, deadLetterKey, id).Result()
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deadletter entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entry DeadLetterEntry
+	if err := json.Unmarshal([]byte(payload), &entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("corrupt deadletter entry: %v", err)})
+		return
+	}
+
+	entry.Job.Attempts = 0
+	if err := backend.Enqueue(ctx, entry.Job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rdb.HDel(ctx, deadLetterKey, id).Err(); err != nil {
+		log.Printf("Requeued %s but failed to clear deadletter entry %s: %v", entry.Job.RequestID, id, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requeued": entry.Job.RequestID})
+}
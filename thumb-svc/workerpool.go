@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeffasante/photo-mood/thumb-svc/queue"
+)
+
+var (
+	workerConcurrency = getEnvInt("WORKER_CONCURRENCY", 4)
+	decodeConcurrency = getEnvInt("DECODE_CONCURRENCY", workerConcurrency)
+	shutdownTimeout   = getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+)
+
+// jobsCtx is the parent context for in-flight work. It's only canceled if a
+// job is still running once shutdownTimeout has elapsed, so a slow decode
+// doesn't block the process forever.
+var (
+	jobsCtx, cancelJobs = context.WithCancel(context.Background())
+	shuttingDown        atomic.Bool
+)
+
+// dispatchedJob pairs a dequeued job with the ack callback its backend gave
+// us, so a worker goroutine can report the outcome without holding a
+// reference back to the backend itself.
+type dispatchedJob struct {
+	job queue.Job
+	ack func(error)
+}
+
+// queueWorker starts one dispatcher goroutine (the only thing that calls
+// backend.Dequeue) feeding a pool of workerConcurrency worker goroutines
+// through a buffered channel, each bounded by a decodeConcurrency semaphore
+// since imaging.Decode is the CPU/memory-heavy part. stop signals the
+// dispatcher to quit pulling new jobs; wg tracks the worker goroutines so
+// main can wait for in-flight work to drain on shutdown.
+func queueWorker(stop <-chan struct{}, wg *sync.WaitGroup) {
+	log.Printf("[%s] Starting %d worker(s) (decode concurrency %d, backend: %s)", workerID, workerConcurrency, decodeConcurrency, queueType)
+
+	if _, ok := backend.(queue.Reclaimer); ok {
+		go reclaimLoop()
+	}
+
+	jobs := make(chan dispatchedJob, workerConcurrency)
+	decodeSem := make(chan struct{}, decodeConcurrency)
+
+	go dispatch(stop, jobs)
+
+	for i := 0; i < workerConcurrency; i++ {
+		wg.Add(1)
+		go runWorker(jobs, decodeSem, wg)
+	}
+}
+
+// dispatch is the only goroutine that calls backend.Dequeue, fanning
+// dequeued jobs out to the worker pool over jobs.
+func dispatch(stop <-chan struct{}, jobs chan<- dispatchedJob) {
+	defer close(jobs)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		job, ack, err := backend.Dequeue(ctx)
+		if err != nil {
+			if err == queue.ErrNoJob {
+				continue
+			}
+			log.Printf("[%s] Dequeue error: %v", workerID, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		log.Printf("[%s] Received job: %s", workerID, job.RequestID)
+
+		select {
+		case jobs <- dispatchedJob{job: job, ack: ack}:
+		case <-stop:
+			// No worker picked this one up before shutdown started; leave it
+			// pending (or requeue it) for the next run instead of losing it.
+			ack(fmt.Errorf("worker shutting down"))
+			return
+		}
+	}
+}
+
+func runWorker(jobs <-chan dispatchedJob, decodeSem chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for dj := range jobs {
+		decodeSem <- struct{}{}
+		processJob(dj.job, dj.ack)
+		<-decodeSem
+	}
+}
+
+func processJob(job queue.Job, ack func(error)) {
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = defaultMaxAttempts
+	}
+	job.Attempts++
+
+	jobCtx, stopWatch := watchControlKey(jobsCtx, job.RequestID)
+	jobResult, procErr := processImage(jobCtx, job)
+	stopWatch()
+
+	switch {
+	case procErr == nil:
+		publishResult(jobResult)
+		ack(nil)
+	case errors.Is(procErr, context.Canceled) && shuttingDown.Load():
+		// requeueForShutdown already puts a fresh copy of the job back on the
+		// queue, so the original dequeue must ack clean (nil) — acking it
+		// with an error too would leave streams/disk redelivering the
+		// original entry via their own pending/retry path, processing the
+		// job twice.
+		log.Printf("[%s] Job %s aborted for shutdown, re-enqueuing", workerID, job.RequestID)
+		requeueForShutdown(job)
+		ack(nil)
+	case errors.Is(procErr, context.Canceled):
+		log.Printf("[%s] Job %s canceled by requester, not retrying", workerID, job.RequestID)
+		publishResult(jobResult)
+		ack(nil)
+	default:
+		// The retry/dead-letter subsystem owns redelivery from here, so the
+		// original dequeue is acked regardless of outcome.
+		handleFailure(job, procErr, jobResult)
+		ack(nil)
+	}
+}
+
+// requeueForShutdown puts a job that was aborted mid-processing back on the
+// queue (reset to its pre-attempt state) so it's picked up fresh next time
+// the service runs, instead of being lost.
+func requeueForShutdown(job queue.Job) {
+	job.Attempts--
+	if err := backend.Enqueue(context.Background(), job); err != nil {
+		log.Printf("[%s] Failed to requeue %s during shutdown: %v", workerID, job.RequestID, err)
+	}
+}
+
+// drainWorkers waits up to shutdownTimeout for in-flight jobs to finish on
+// their own; if the deadline passes, it cancels jobsCtx so processImage
+// aborts at its next checkpoint and waits for workers to actually exit.
+func drainWorkers(wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Printf("[%s] All in-flight jobs drained", workerID)
+	case <-time.After(shutdownTimeout):
+		log.Printf("[%s] Shutdown timeout exceeded; aborting remaining in-flight jobs", workerID)
+		shuttingDown.Store(true)
+		cancelJobs()
+		<-done
+	}
+}